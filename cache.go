@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/spf13/viper"
+)
+
+var (
+	cacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "promalert_plot_cache_hits_total",
+		Help: "Number of plot cache lookups that found a cached URL.",
+	}, []string{"backend"})
+	cacheMisses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "promalert_plot_cache_misses_total",
+		Help: "Number of plot cache lookups that found no cached URL.",
+	}, []string{"backend"})
+	cacheEvictions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "promalert_plot_cache_evictions_total",
+		Help: "Number of cache entries evicted to stay under max_entries.",
+	}, []string{"backend"})
+)
+
+// PlotCacheEntry is what PlotCache stores for one rendered plot: the public
+// URL most notifiers link to, plus the PNG bytes the email notifier needs to
+// attach inline. Both must survive a cache hit, or a notifier that needs the
+// PNG silently gets nothing on every re-fire.
+type PlotCacheEntry struct {
+	URL string
+	PNG []byte
+}
+
+// PlotCache maps a content-addressed key to a previously rendered plot, so
+// re-fires of the same alert (Alertmanager re-sends every group interval)
+// can skip re-querying Prometheus, re-rendering and re-uploading to S3.
+type PlotCache interface {
+	Get(key string) (entry PlotCacheEntry, ok bool)
+	Set(key string, entry PlotCacheEntry)
+}
+
+// CacheConfig is the `cache` config section.
+type CacheConfig struct {
+	Backend    string        `mapstructure:"backend"`
+	TTL        time.Duration `mapstructure:"ttl"`
+	MaxEntries int           `mapstructure:"max_entries"`
+	RedisAddr  string        `mapstructure:"redis_addr"`
+}
+
+// BuildPlotCache constructs the PlotCache described by cfg.
+func BuildPlotCache(cfg CacheConfig) (PlotCache, error) {
+	switch cfg.Backend {
+	case "", "memory":
+		return NewMemoryPlotCache(cfg.MaxEntries, cfg.TTL), nil
+	case "redis":
+		if cfg.RedisAddr == "" {
+			return nil, fmt.Errorf("cache backend %q requires redis_addr", cfg.Backend)
+		}
+		return NewRedisPlotCache(cfg.RedisAddr, cfg.TTL), nil
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", cfg.Backend)
+	}
+}
+
+var (
+	plotCache     PlotCache
+	plotCacheOnce sync.Once
+	plotCacheErr  error
+)
+
+// PlotCacheInstance returns the process-wide PlotCache, built from the
+// `cache` config section on first use.
+func PlotCacheInstance() (PlotCache, error) {
+	plotCacheOnce.Do(func() {
+		var cfg CacheConfig
+		if err := viper.UnmarshalKey("cache", &cfg); err != nil {
+			plotCacheErr = fmt.Errorf("failed to parse cache config: %v", err)
+			return
+		}
+		if cfg.TTL == 0 {
+			cfg.TTL = 10 * time.Minute
+		}
+		if cfg.MaxEntries == 0 {
+			cfg.MaxEntries = 1000
+		}
+
+		plotCache, plotCacheErr = BuildPlotCache(cfg)
+	})
+	return plotCache, plotCacheErr
+}
+
+// PlotCacheKey builds the content-addressed cache key for one of alert's
+// PlotExprs: its fingerprint, when it started firing, which resolved-time
+// bucket it falls in (0 while still firing), and exprIndex, the position of
+// the PlotExpr within GetPlotExpr's result (an `and`/`or`/`unless` alert
+// renders more than one plot, each needing its own cache entry). Re-fires of
+// the same firing alert, or of its resolution within the same bucket,
+// collapse onto the same entries.
+func PlotCacheKey(alert Alert, exprIndex int) string {
+	return fmt.Sprintf("%s|%d|%d|%d", alert.Fingerprint, alert.StartsAt.Unix(), resolvedBucket(alert), exprIndex)
+}
+
+func resolvedBucket(alert Alert) int64 {
+	if alert.Status != "resolved" {
+		return 0
+	}
+	const bucketSize = time.Minute
+	return alert.EndsAt.Truncate(bucketSize).Unix()
+}
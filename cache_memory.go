@@ -0,0 +1,76 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type memoryCacheEntry struct {
+	entry     PlotCacheEntry
+	expiresAt time.Time
+}
+
+// MemoryPlotCache is the default PlotCache: an in-process map bounded by
+// maxEntries. When full it evicts a uniformly random victim rather than
+// tracking LRU metadata -- cheap, and a good fit for our workload since
+// re-fires cluster in time, so a random victim is about as likely to be
+// stale as the true least-recently-used one.
+type MemoryPlotCache struct {
+	mu         sync.Mutex
+	entries    map[string]memoryCacheEntry
+	ttl        time.Duration
+	maxEntries int
+}
+
+func NewMemoryPlotCache(maxEntries int, ttl time.Duration) *MemoryPlotCache {
+	return &MemoryPlotCache{
+		entries:    make(map[string]memoryCacheEntry),
+		ttl:        ttl,
+		maxEntries: maxEntries,
+	}
+}
+
+func (c *MemoryPlotCache) Get(key string) (PlotCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		cacheMisses.WithLabelValues("memory").Inc()
+		return PlotCacheEntry{}, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		cacheMisses.WithLabelValues("memory").Inc()
+		return PlotCacheEntry{}, false
+	}
+
+	cacheHits.WithLabelValues("memory").Inc()
+	return entry.entry, true
+}
+
+func (c *MemoryPlotCache) Set(key string, entry PlotCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.maxEntries {
+		c.evictRandom()
+	}
+
+	c.entries[key] = memoryCacheEntry{entry: entry, expiresAt: time.Now().Add(c.ttl)}
+}
+
+// evictRandom drops a uniformly random entry. Callers must hold c.mu.
+func (c *MemoryPlotCache) evictRandom() {
+	victim := rand.Intn(len(c.entries))
+	i := 0
+	for key := range c.entries {
+		if i == victim {
+			delete(c.entries, key)
+			cacheEvictions.WithLabelValues("memory").Inc()
+			return
+		}
+		i++
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryPlotCacheGetSet(t *testing.T) {
+	cache := NewMemoryPlotCache(10, time.Minute)
+
+	if _, ok := cache.Get("missing"); ok {
+		t.Fatal("expected miss on empty cache")
+	}
+
+	want := PlotCacheEntry{URL: "https://example.com/plot.png", PNG: []byte("fake-png")}
+	cache.Set("key", want)
+
+	got, ok := cache.Get("key")
+	if !ok || got.URL != want.URL || string(got.PNG) != string(want.PNG) {
+		t.Fatalf("Get() = %+v, %v, want hit with %+v", got, ok, want)
+	}
+}
+
+func TestMemoryPlotCacheExpires(t *testing.T) {
+	cache := NewMemoryPlotCache(10, -time.Second)
+	cache.Set("key", PlotCacheEntry{URL: "https://example.com/plot.png"})
+
+	if _, ok := cache.Get("key"); ok {
+		t.Fatal("expected miss for an already-expired entry")
+	}
+}
+
+func TestMemoryPlotCacheEvictsWhenFull(t *testing.T) {
+	cache := NewMemoryPlotCache(2, time.Minute)
+	cache.Set("a", PlotCacheEntry{URL: "url-a"})
+	cache.Set("b", PlotCacheEntry{URL: "url-b"})
+	cache.Set("c", PlotCacheEntry{URL: "url-c"})
+
+	if len(cache.entries) != 2 {
+		t.Fatalf("len(entries) = %d, want 2 (bounded by maxEntries)", len(cache.entries))
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const redisPlotCacheKeyPrefix = "promalert:plot:"
+
+// RedisPlotCache is the opt-in PlotCache backend for deployments running
+// more than one promalert instance, so a cache hit on one instance is
+// visible to the others.
+type RedisPlotCache struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func NewRedisPlotCache(addr string, ttl time.Duration) *RedisPlotCache {
+	return &RedisPlotCache{
+		client: redis.NewClient(&redis.Options{Addr: addr}),
+		ttl:    ttl,
+	}
+}
+
+func (c *RedisPlotCache) Get(key string) (PlotCacheEntry, bool) {
+	raw, err := c.client.Get(context.Background(), redisPlotCacheKeyPrefix+key).Bytes()
+	if err == redis.Nil {
+		cacheMisses.WithLabelValues("redis").Inc()
+		return PlotCacheEntry{}, false
+	}
+	if err != nil {
+		log.Printf("redis cache get failed: %v", err)
+		cacheMisses.WithLabelValues("redis").Inc()
+		return PlotCacheEntry{}, false
+	}
+
+	var entry PlotCacheEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		log.Printf("redis cache entry corrupt: %v", err)
+		cacheMisses.WithLabelValues("redis").Inc()
+		return PlotCacheEntry{}, false
+	}
+
+	cacheHits.WithLabelValues("redis").Inc()
+	return entry, true
+}
+
+func (c *RedisPlotCache) Set(key string, entry PlotCacheEntry) {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("redis cache entry marshal failed: %v", err)
+		return
+	}
+	if err := c.client.Set(context.Background(), redisPlotCacheKeyPrefix+key, raw, c.ttl).Err(); err != nil {
+		log.Printf("redis cache set failed: %v", err)
+	}
+}
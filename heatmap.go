@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+
+	"github.com/prometheus/common/model"
+	"gonum.org/v1/plot/palette/brewer"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+)
+
+// histogramGrid implements gonum.org/v1/plot/plotter.GridXYZ over a
+// Prometheus native histogram: X is time, Y is the (sorted, finite) `le`
+// bucket boundaries, and Z is the per-timestamp bucket density, i.e. the
+// count that landed specifically in that bucket rather than the cumulative
+// `_bucket` count Prometheus exposes.
+type histogramGrid struct {
+	times   []float64
+	buckets []float64
+	// density[bucket][time]
+	density [][]float64
+	// infDensity[time] is the density of the dropped +Inf bucket: the
+	// observations that landed above the highest finite boundary. It plays
+	// no part in the drawable grid, but quantile's total must still include
+	// it or a quantile search target computed from only the finite buckets
+	// undercounts whenever a non-trivial share of observations exceed the
+	// highest boundary.
+	infDensity []float64
+}
+
+func (g *histogramGrid) Dims() (c, r int)   { return len(g.times), len(g.buckets) }
+func (g *histogramGrid) X(c int) float64    { return g.times[c] }
+func (g *histogramGrid) Y(r int) float64    { return g.buckets[r] }
+func (g *histogramGrid) Z(c, r int) float64 { return g.density[r][c] }
+
+// quantile returns, for every timestamp, the smallest bucket boundary whose
+// cumulative count reaches q of the total count at that timestamp. Unlike
+// `histogram_quantile` it does not interpolate within the bucket, which is
+// close enough for an overlay line.
+func (g *histogramGrid) quantile(q float64) plotter.XYs {
+	points := make(plotter.XYs, len(g.times))
+	for t, ts := range g.times {
+		var total float64
+		for b := range g.buckets {
+			total += g.density[b][t]
+		}
+		if g.infDensity != nil {
+			total += g.infDensity[t]
+		}
+
+		target := total * q
+		var cumulative float64
+		level := g.buckets[len(g.buckets)-1]
+		for b, bound := range g.buckets {
+			cumulative += g.density[b][t]
+			if cumulative >= target {
+				level = bound
+				break
+			}
+		}
+
+		points[t] = plotter.XY{X: ts, Y: level}
+	}
+	return points
+}
+
+// buildHistogramGrid groups a matrix of `_bucket` series by their `le`
+// label and converts Prometheus' cumulative bucket counts into per-bucket
+// densities suitable for a heatmap.
+func buildHistogramGrid(metrics model.Matrix) (*histogramGrid, error) {
+	type bucket struct {
+		le     float64
+		sample *model.SampleStream
+	}
+
+	var buckets []bucket
+	var infBucket *model.SampleStream
+	for _, sample := range metrics {
+		leValue, ok := sample.Metric[model.LabelName("le")]
+		if !ok {
+			return nil, fmt.Errorf("series %v has no le label", sample.Metric)
+		}
+
+		le, err := strconv.ParseFloat(string(leValue), 64)
+		if err != nil {
+			// +Inf: dropped from the drawable grid, the highest finite
+			// bucket already carries its visual weight, but its count
+			// still has to feed quantile's total -- see infDensity below.
+			infBucket = sample
+			continue
+		}
+		buckets = append(buckets, bucket{le: le, sample: sample})
+	}
+
+	if len(buckets) == 0 {
+		return nil, fmt.Errorf("no finite le buckets found")
+	}
+
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].le < buckets[j].le })
+
+	times := make([]float64, len(buckets[0].sample.Values))
+	for i, v := range buckets[0].sample.Values {
+		times[i] = float64(v.Timestamp.Unix())
+	}
+
+	levels := make([]float64, len(buckets))
+	density := make([][]float64, len(buckets))
+	var previous []float64
+
+	for b, bkt := range buckets {
+		levels[b] = bkt.le
+		density[b] = make([]float64, len(times))
+
+		if len(bkt.sample.Values) != len(times) {
+			return nil, fmt.Errorf("bucket le=%v has %d samples, want %d", bkt.le, len(bkt.sample.Values), len(times))
+		}
+
+		cumulative := make([]float64, len(times))
+		for t, v := range bkt.sample.Values {
+			f, err := strconv.ParseFloat(v.Value.String(), 64)
+			if err != nil {
+				return nil, fmt.Errorf("bucket sample value not float: %s", v.Value.String())
+			}
+			cumulative[t] = f
+
+			if previous == nil {
+				density[b][t] = f
+			} else {
+				density[b][t] = f - previous[t]
+			}
+		}
+
+		previous = cumulative
+	}
+
+	var infDensity []float64
+	if infBucket != nil {
+		if len(infBucket.Values) != len(times) {
+			return nil, fmt.Errorf("+Inf bucket has %d samples, want %d", len(infBucket.Values), len(times))
+		}
+		infDensity = make([]float64, len(times))
+		for t, v := range infBucket.Values {
+			f, err := strconv.ParseFloat(v.Value.String(), 64)
+			if err != nil {
+				return nil, fmt.Errorf("+Inf bucket sample value not float: %s", v.Value.String())
+			}
+			infDensity[t] = f - previous[t]
+		}
+	}
+
+	return &histogramGrid{times: times, buckets: levels, density: density, infDensity: infDensity}, nil
+}
+
+// PlotHeatmap renders a native-histogram metric (series sharing an `le`
+// label) as a heatmap of bucket densities, overlaid with p50/p90/p99 lines
+// and the alert threshold.
+func PlotHeatmap(metrics, thresholdMetrics model.Matrix, expr PlotExpr) (io.WriterTo, error) {
+	p, evalTextStyle, err := newStyledPlot()
+	if err != nil {
+		return nil, err
+	}
+
+	grid, err := buildHistogramGrid(metrics)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build histogram grid: %v", err)
+	}
+
+	palette, err := brewer.GetPalette(brewer.TypeSequential, "YlOrRd", 9)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get heatmap palette: %v", err)
+	}
+
+	heat := plotter.NewHeatMap(grid, palette)
+	p.Add(heat)
+
+	quantileColors := map[float64]color.Color{
+		0.5:  color.NRGBA{B: 255, A: 255},
+		0.9:  color.NRGBA{G: 150, A: 255},
+		0.99: color.NRGBA{R: 255, A: 255},
+	}
+
+	var lastEvalValue float64
+	for _, q := range []float64{0.5, 0.9, 0.99} {
+		points := grid.quantile(q)
+		if len(points) > 0 && q == 0.99 {
+			lastEvalValue = points[len(points)-1].Y
+		}
+
+		line, err := plotter.NewLine(points)
+		if err != nil {
+			log.Printf("failed to draw p%d line: %v", int(q*100), err)
+			continue
+		}
+		line.LineStyle.Width = vg.Points(1.5)
+		line.LineStyle.Color = quantileColors[q]
+		p.Add(line)
+		p.Legend.Add(fmt.Sprintf("p%d", int(q*100)), line)
+	}
+
+	if expr.ThresholdFormula != "" && len(thresholdMetrics) > 0 {
+		var lastThreshold *plotter.Line
+		for _, sample := range thresholdMetrics {
+			data := make(plotter.XYs, len(sample.Values))
+			for i, v := range sample.Values {
+				data[i].X = float64(v.Timestamp.Unix())
+				f, err := strconv.ParseFloat(v.Value.String(), 64)
+				if err != nil {
+					return nil, fmt.Errorf("threshold sample value not float: %s", v.Value.String())
+				}
+				data[i].Y = f
+			}
+
+			threshold, err := plotter.NewLine(data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to draw dynamic alert threshold: %v", err)
+			}
+			threshold.LineStyle.Width = vg.Points(1)
+			threshold.LineStyle.Color = color.Black
+			threshold.LineStyle.Dashes = []vg.Length{vg.Points(4), vg.Points(2)}
+			p.Add(threshold)
+			lastThreshold = threshold
+		}
+		if lastThreshold != nil {
+			p.Legend.Add("alert threshold", lastThreshold)
+		}
+	} else {
+		threshold, err := plotter.NewLine(plotter.XYs{{X: p.X.Min, Y: expr.Level}, {X: p.X.Max, Y: expr.Level}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to draw alert threshold: %v", err)
+		}
+		threshold.LineStyle.Width = vg.Points(1)
+		threshold.LineStyle.Color = color.Black
+		threshold.LineStyle.Dashes = []vg.Length{vg.Points(4), vg.Points(2)}
+		p.Add(threshold)
+		p.Legend.Add("alert threshold", threshold)
+	}
+
+	return renderPlotCanvas(p, evalTextStyle, lastEvalValue)
+}
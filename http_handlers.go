@@ -1,16 +1,17 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"github.com/prometheus/common/model"
-	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/viper"
 	"log"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,7 +19,26 @@ func healthz(w http.ResponseWriter, r *http.Request) {
 	_, _ = fmt.Fprint(w, "Ok!")
 }
 
+// metricsHTTPHandler serves promalert's own Prometheus metrics, registered
+// on /metrics alongside /healthz and /webhook.
+var metricsHTTPHandler = promhttp.Handler()
+
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	metricsHTTPHandler.ServeHTTP(w, r)
+}
+
+const defaultWorkerPoolSize = 4
+
+func workerPoolSize() int {
+	if size := viper.GetInt("worker_pool_size"); size > 0 {
+		return size
+	}
+	return defaultWorkerPoolSize
+}
+
 func webhook(w http.ResponseWriter, r *http.Request) {
+	defer observeSince(webhookDuration, time.Now())
+
 	if viper.GetBool("debug") {
 		// Save a copy of this request for debugging.
 		requestDump, err := httputil.DumpRequest(r, true)
@@ -41,123 +61,191 @@ func webhook(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Alerts: GroupLabels=%v, CommonLabels=%v", m.GroupLabels, m.CommonLabels)
 
+	// Each alert is isolated in its own goroutine, bounded by a worker
+	// pool, so one failing alert (a transient Prometheus/S3/notifier
+	// error) can't stall or drop the rest of the batch.
+	sem := make(chan struct{}, workerPoolSize())
+	var wg sync.WaitGroup
+	var failed int32
+
 	for _, alert := range m.Alerts {
-		log.Printf("Alert: status=%s,Labels=%v,Annotations=%v", alert.Status, alert.Labels, alert.Annotations)
-		severity := alert.Labels["severity"]
+		alert := alert
+		wg.Add(1)
+		sem <- struct{}{}
 
-		log.Printf("no action on severity: %s", severity)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
 
-		generatorUrl, err := url.Parse(alert.GeneratorURL)
-		if err != nil {
-			panic(err)
-		}
+			if err := processAlert(alert); err != nil {
+				atomic.AddInt32(&failed, 1)
+				logger.Error("failed to process alert", "alert_fingerprint", alert.Fingerprint, "error", err)
+			}
+		}()
+	}
 
-		generatorQuery, _ := url.ParseQuery(generatorUrl.RawQuery)
+	wg.Wait()
 
-		var alertFormula string
-		var alertLevel float64
-		var alertOperator string
+	// Only fail the whole batch back to Alertmanager when every alert in
+	// it failed, so Alertmanager's own retry logic engages correctly
+	// without re-sending alerts we already delivered.
+	if total := len(m.Alerts); total > 0 && int(failed) == total {
+		http.Error(w, "failed to process alerts", http.StatusBadGateway)
+		return
+	}
 
-		for key, param := range generatorQuery {
-			if key == "g0.expr" {
-				alertFormula = param[0]
-				break
-			}
-		}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write([]byte("{\"success\": true}")); err != nil {
+		logger.Error("failed to send response", "error", err)
+	}
+}
 
-		fmt.Println(alertFormula)
-		expr, _ := promql.ParseExpr(alertFormula)
+// processAlert runs a single alert through the query/render/upload/notify
+// pipeline. It never calls fatal: every failure is returned so the caller
+// can isolate it to this alert instead of crashing the whole batch.
+func processAlert(alert Alert) error {
+	alertLogger := logger.With("alert_fingerprint", alert.Fingerprint)
 
-		if binaryExpr, ok := expr.(*promql.BinaryExpr); ok {
-			alertFormula = binaryExpr.LHS.String()
-			alertLevel, _ = strconv.ParseFloat(binaryExpr.RHS.String(), 64)
+	severity := alert.Labels["severity"]
+	alertsReceivedTotal.WithLabelValues(string(alert.Status), severity).Inc()
+	alertLogger.Info("processing alert", "status", alert.Status, "severity", severity)
 
-			if binaryExpr.Op == promql.ItemLTE || binaryExpr.Op == promql.ItemLSS {
-				alertOperator = "LE"
-			} else {
-				alertOperator = "GE"
-			}
+	generatorUrl, err := url.Parse(alert.GeneratorURL)
+	if err != nil {
+		return fmt.Errorf("failed to parse generator URL: %v", err)
+	}
+
+	generatorQuery, _ := url.ParseQuery(generatorUrl.RawQuery)
+
+	var alertFormula string
+	for key, param := range generatorQuery {
+		if key == "g0.expr" {
+			alertFormula = param[0]
+			break
 		}
+	}
 
-		// Fetch from Prometheus
-		log.Printf("Querying Prometheus %s", alertFormula)
+	// and/or/unless combinations and vector-vector comparisons draw as more
+	// than one PlotExpr; each gets its own cache entry, render and upload,
+	// but only the first successfully rendered one is sent to the notifiers.
+	plotExprs, err := GetPlotExpr(alertFormula)
+	if err != nil {
+		return fmt.Errorf("failed to parse alert expression %q: %v", alertFormula, err)
+	}
+	if len(plotExprs) == 0 {
+		return fmt.Errorf("alert expression %q has no plottable sub-expression", alertFormula)
+	}
 
-		var queryTime time.Time
-		var duration time.Duration
+	cache, err := PlotCacheInstance()
+	if err != nil {
+		return fmt.Errorf("failed to load plot cache: %v", err)
+	}
 
-		if alert.StartsAt.Second() > alert.EndsAt.Second() {
-			queryTime = alert.StartsAt
+	notifiers, route, err := Notifiers()
+	if err != nil {
+		return fmt.Errorf("failed to load notifiers: %v", err)
+	}
+	notifierNames := ResolveNotifiers(route, alert.Labels)
+
+	var queryTime time.Time
+	var duration time.Duration
+	if alert.StartsAt.Second() > alert.EndsAt.Second() {
+		queryTime = alert.StartsAt
+		duration = time.Minute * 20
+	} else {
+		queryTime = alert.EndsAt
+		duration = queryTime.Sub(alert.StartsAt)
+
+		if duration < time.Minute*20 {
 			duration = time.Minute * 20
-		} else {
-			queryTime = alert.EndsAt
-			duration = queryTime.Sub(alert.StartsAt)
-
-			if duration < time.Minute*20 {
-				duration = time.Minute * 20
-			}
 		}
+	}
+	resolution := time.Duration(viper.GetInt64("metric_resolution"))
+	prometheusURL := viper.GetString("prometheus_url")
 
-		log.Printf("Querying Time %v Duration: %v", queryTime, duration)
-
-		metrics, err := Metrics(
-			viper.GetString("prometheus_url"),
-			alertFormula,
-			queryTime,
-			duration,
-			time.Duration(viper.GetInt64("metric_resolution")),
-		)
-		fatal(err, "failed to get metrics")
-
-		var selectedMetrics model.Matrix
-		var founded bool
-
-		for _, metric := range metrics {
-			log.Printf("Metric fetched: %v", metric.Metric)
-			founded = false
-			for label, value := range metric.Metric {
-				if originValue, ok := alert.Labels[string(label)]; ok {
-					if originValue == string(value) {
-						founded = true
-					} else {
-						founded = false
-						break
-					}
-				}
-			}
+	var notifyErrs []error
+	notifyPlots := make([]NotifyPlot, 0, len(plotExprs))
 
-			if founded {
-				log.Printf("Best match founded: %v", metric.Metric)
-				selectedMetrics = model.Matrix{metric}
-				break
-			}
+	for i, plotExpr := range plotExprs {
+		cacheKey := PlotCacheKey(alert, i)
+
+		if cached, hit := cache.Get(cacheKey); hit {
+			alertLogger.Info("plot cache hit, skipping query/render/upload", "stage", "cache", "formula", plotExpr.Formula)
+			notifyPlots = append(notifyPlots, NotifyPlot{URL: cached.URL, PNG: cached.PNG})
+			continue
 		}
 
-		if !founded {
-			log.Printf("Best match not founded, use entire dataset. Labels to search: %v", alert.Labels)
-			selectedMetrics = metrics
+		renderStart := time.Now()
+		plotted, err := Plot(plotExpr, queryTime, duration, resolution, prometheusURL, alert)
+		if err != nil {
+			notifyErrs = append(notifyErrs, fmt.Errorf("failed to plot %q: %v", plotExpr.Formula, err))
+			continue
 		}
 
-		// Plot
-		log.Printf("Creating plot: %s", alert.Annotations["summary"])
-		plot, err := Plot(selectedMetrics, alertLevel, alertOperator)
-		fatal(err, "failed to create plot")
+		var plotBuf bytes.Buffer
+		if _, err := plotted.WriteTo(&plotBuf); err != nil {
+			notifyErrs = append(notifyErrs, fmt.Errorf("failed to buffer plot for %q: %v", plotExpr.Formula, err))
+			continue
+		}
+		alertLogger.Info("rendered plot", "stage", "render", "formula", plotExpr.Formula, "duration_ms", time.Since(renderStart).Milliseconds())
+		plotPNG := plotBuf.Bytes()
+
+		var publicURL string
+		uploadStart := time.Now()
+		retryErr := withRetry(retryConfig(), func() error {
+			var uploadErr error
+			publicURL, uploadErr = UploadFile(viper.GetString("s3_bucket"), viper.GetString("s3_region"), bytes.NewReader(plotPNG))
+			return uploadErr
+		})
+		observeSince(s3UploadDuration, uploadStart)
+		if retryErr != nil {
+			notifyErrs = append(notifyErrs, fmt.Errorf("failed to upload plot for %q: %v", plotExpr.Formula, retryErr))
+			continue
+		}
+		s3UploadBytes.Observe(float64(len(plotPNG)))
+		alertLogger.Info("uploaded plot", "stage", "upload", "duration_ms", time.Since(uploadStart).Milliseconds(), "url", publicURL)
+
+		cache.Set(cacheKey, PlotCacheEntry{URL: publicURL, PNG: plotPNG})
+		notifyPlots = append(notifyPlots, NotifyPlot{URL: publicURL, PNG: plotPNG})
+	}
 
-		publicURL, err := UploadFile(viper.GetString("s3_bucket"), viper.GetString("s3_region"), plot)
-		fatal(err, "failed to upload")
-		log.Printf("Graph uploaded, URL: %s", publicURL)
+	// Every notifier fires exactly once per alert, not once per PlotExpr --
+	// and/or/unless alerts render more than one plot but are still a single
+	// Alertmanager firing, so they must still produce a single page/message.
+	// The first successfully rendered plot is the one attached/linked; it
+	// covers the overwhelming common case of a single-condition alert, and
+	// still gives multi-condition alerts a representative graph rather than
+	// a flood of one per side.
+	if len(notifyPlots) > 0 {
+		notifyPlot := notifyPlots[0]
+
+		for _, name := range notifierNames {
+			notifier, ok := notifiers[name]
+			if !ok {
+				alertLogger.Warn("route references unknown notifier, skipping", "notifier", name)
+				continue
+			}
 
-		respChannel, respTimestamp, err := SlackSendAlertMessage(
-			alert,
-			viper.GetString("slack_token"),
-			viper.GetString("slack_channel"),
-			publicURL,
-			viper.GetString("message_template"),
-		)
-		fatal(err, "failed to send slack message")
-		log.Printf("Slack message sended, channel: %s thread: %s", respChannel, respTimestamp)
+			sendStart := time.Now()
+			retryErr := withRetry(retryConfig(), func() error {
+				return notifier.Notify(alert, notifyPlot)
+			})
+			notifySendDuration.WithLabelValues(name).Observe(time.Since(sendStart).Seconds())
+
+			if retryErr != nil {
+				notifySendErrorsTotal.WithLabelValues(name).Inc()
+				alertLogger.Error("notifier delivery failed", "stage", "notify", "notifier", name, "duration_ms", time.Since(sendStart).Milliseconds(), "error", retryErr)
+				notifyErrs = append(notifyErrs, fmt.Errorf("%s: %v", name, retryErr))
+				continue
+			}
+
+			alertLogger.Info("delivered alert", "stage", "notify", "notifier", name, "duration_ms", time.Since(sendStart).Milliseconds())
+		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	_, err := w.Write([]byte("{\"success\": true}"))
-	fatal(err, "failed to send response")
+	if len(notifyErrs) > 0 {
+		return fmt.Errorf("failed to notify via %d destination(s): %v", len(notifyErrs), notifyErrs)
+	}
+
+	return nil
 }
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+)
+
+// logger is promalert's structured logger. Stages log alert_fingerprint,
+// stage and duration_ms so a single alert's path through the pipeline can
+// be traced even when other alerts are being processed concurrently.
+var logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metrics about promalert itself, registered on /metrics so the system it
+// serves can also alert on its own failure modes (e.g. a rising Prometheus
+// query error rate).
+var (
+	alertsReceivedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "promalert_alerts_received_total",
+		Help: "Number of alerts received from Alertmanager, by status and severity.",
+	}, []string{"status", "severity"})
+
+	prometheusQueriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "promalert_prometheus_queries_total",
+		Help: "Number of range queries issued against Prometheus, by result.",
+	}, []string{"result"})
+
+	prometheusQueryDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "promalert_prometheus_query_duration_seconds",
+		Help:    "Latency of Prometheus range queries.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	plotRenderDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "promalert_plot_render_duration_seconds",
+		Help:    "Latency of rendering a plot PNG.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	s3UploadDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "promalert_s3_upload_duration_seconds",
+		Help:    "Latency of uploading a rendered plot to S3.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	s3UploadBytes = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "promalert_s3_upload_bytes",
+		Help:    "Size in bytes of plots uploaded to S3.",
+		Buckets: prometheus.ExponentialBuckets(1024, 2, 10),
+	})
+
+	notifySendDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "promalert_notify_send_duration_seconds",
+		Help:    "Latency of delivering an alert through a Notifier.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"notifier"})
+
+	notifySendErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "promalert_notify_send_errors_total",
+		Help: "Number of failed Notifier deliveries, by notifier.",
+	}, []string{"notifier"})
+
+	webhookDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "promalert_webhook_duration_seconds",
+		Help:    "End-to-end duration of handling an Alertmanager webhook request.",
+		Buckets: prometheus.DefBuckets,
+	})
+)
+
+func observeSince(h prometheus.Histogram, start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
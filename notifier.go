@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// defaultNotifierTimeout bounds every notifier that talks to a remote
+// server directly -- the plain-HTTP backends (PagerDuty, Teams, Telegram,
+// generic webhook) and EmailNotifier's SMTP dial. Without it, one
+// unresponsive endpoint hangs the goroutine withRetry runs it in for good,
+// and enough of those permanently exhaust the bounded worker pool in
+// http_handlers.go.
+const defaultNotifierTimeout = 10 * time.Second
+
+// notifierTimeout reads the `notify.http_timeout` config key, falling back
+// to defaultNotifierTimeout when unset.
+func notifierTimeout() time.Duration {
+	if timeout := viper.GetDuration("notify.http_timeout"); timeout > 0 {
+		return timeout
+	}
+	return defaultNotifierTimeout
+}
+
+// notifierHTTPClient returns an *http.Client timed out per notifierTimeout,
+// shared by every notifier that POSTs JSON directly.
+func notifierHTTPClient() *http.Client {
+	return &http.Client{Timeout: notifierTimeout()}
+}
+
+// NotifyPlot carries the rendered alert graph to a Notifier: the public S3
+// URL that most backends link to, plus the raw PNG bytes for backends (like
+// email) that need to attach it directly rather than just linking it.
+type NotifyPlot struct {
+	URL string
+	PNG []byte
+}
+
+// Notifier delivers an alert to a single destination (Slack, email,
+// PagerDuty, ...). Implementations must be safe for concurrent use.
+type Notifier interface {
+	// Name is the identifier used in config and route `notifiers` lists,
+	// e.g. "slack" or "oncall-pagerduty".
+	Name() string
+	Notify(alert Alert, plot NotifyPlot) error
+}
+
+// NotifierConfig describes one entry of the `notifiers` config list. Exactly
+// one of the backend-specific blocks should be set, matching Type.
+type NotifierConfig struct {
+	Name      string           `mapstructure:"name"`
+	Type      string           `mapstructure:"type"`
+	Slack     *SlackConfig     `mapstructure:"slack"`
+	Email     *EmailConfig     `mapstructure:"email"`
+	PagerDuty *PagerDutyConfig `mapstructure:"pagerduty"`
+	Teams     *TeamsConfig     `mapstructure:"teams"`
+	Telegram  *TelegramConfig  `mapstructure:"telegram"`
+	Webhook   *WebhookConfig   `mapstructure:"webhook"`
+}
+
+// Route is one node of the notification routing tree. It mirrors
+// Alertmanager's own route matchers: a route matches an alert when every
+// label in Match is present with the same value, in which case its
+// Notifiers fire and its child Routes are evaluated in turn. Set Continue
+// to also keep evaluating the remaining sibling routes after a match.
+type Route struct {
+	Match     map[string]string `mapstructure:"match"`
+	Notifiers []string          `mapstructure:"notifiers"`
+	Continue  bool              `mapstructure:"continue"`
+	Routes    []Route           `mapstructure:"routes"`
+}
+
+func (r Route) matches(labels map[string]string) bool {
+	for k, v := range r.Match {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ResolveNotifiers walks the route tree and returns the distinct notifier
+// names that should receive an alert carrying the given labels. As in
+// Alertmanager, only the first matching route among a set of siblings fires
+// unless that route sets Continue; its Notifiers and matching descendants
+// always contribute regardless of Continue, which only affects whether its
+// remaining siblings are still considered.
+func ResolveNotifiers(root Route, labels map[string]string) []string {
+	if !root.matches(labels) {
+		return nil
+	}
+	names := append([]string{}, root.Notifiers...)
+	names = append(names, resolveSiblingNotifiers(root.Routes, labels)...)
+	return dedupeStrings(names)
+}
+
+// resolveSiblingNotifiers evaluates routes in order, stopping after the
+// first match unless it sets Continue.
+func resolveSiblingNotifiers(routes []Route, labels map[string]string) []string {
+	var names []string
+	for _, route := range routes {
+		if !route.matches(labels) {
+			continue
+		}
+		names = append(names, route.Notifiers...)
+		names = append(names, resolveSiblingNotifiers(route.Routes, labels)...)
+		if !route.Continue {
+			break
+		}
+	}
+	return names
+}
+
+func dedupeStrings(in []string) []string {
+	seen := make(map[string]bool, len(in))
+	out := make([]string, 0, len(in))
+	for _, s := range in {
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		out = append(out, s)
+	}
+	return out
+}
+
+// BuildNotifier constructs the Notifier described by cfg.
+func BuildNotifier(cfg NotifierConfig) (Notifier, error) {
+	switch cfg.Type {
+	case "slack":
+		if cfg.Slack == nil {
+			return nil, fmt.Errorf("notifier %q: missing slack config", cfg.Name)
+		}
+		return NewSlackNotifier(cfg.Name, *cfg.Slack), nil
+	case "email":
+		if cfg.Email == nil {
+			return nil, fmt.Errorf("notifier %q: missing email config", cfg.Name)
+		}
+		return NewEmailNotifier(cfg.Name, *cfg.Email), nil
+	case "pagerduty":
+		if cfg.PagerDuty == nil {
+			return nil, fmt.Errorf("notifier %q: missing pagerduty config", cfg.Name)
+		}
+		return NewPagerDutyNotifier(cfg.Name, *cfg.PagerDuty), nil
+	case "teams":
+		if cfg.Teams == nil {
+			return nil, fmt.Errorf("notifier %q: missing teams config", cfg.Name)
+		}
+		return NewTeamsNotifier(cfg.Name, *cfg.Teams), nil
+	case "telegram":
+		if cfg.Telegram == nil {
+			return nil, fmt.Errorf("notifier %q: missing telegram config", cfg.Name)
+		}
+		return NewTelegramNotifier(cfg.Name, *cfg.Telegram), nil
+	case "webhook":
+		if cfg.Webhook == nil {
+			return nil, fmt.Errorf("notifier %q: missing webhook config", cfg.Name)
+		}
+		return NewWebhookNotifier(cfg.Name, *cfg.Webhook), nil
+	default:
+		return nil, fmt.Errorf("notifier %q: unknown type %q", cfg.Name, cfg.Type)
+	}
+}
+
+var (
+	notifierRegistry     map[string]Notifier
+	notifierRoute        Route
+	notifierRegistryOnce sync.Once
+	notifierRegistryErr  error
+)
+
+// Notifiers returns the notifier registry and route tree built from the
+// `notifiers` and `route` config sections, parsing them on first use.
+func Notifiers() (map[string]Notifier, Route, error) {
+	notifierRegistryOnce.Do(func() {
+		var configs []NotifierConfig
+		if err := viper.UnmarshalKey("notifiers", &configs); err != nil {
+			notifierRegistryErr = fmt.Errorf("failed to parse notifiers config: %v", err)
+			return
+		}
+
+		registry := make(map[string]Notifier, len(configs))
+		for _, cfg := range configs {
+			n, err := BuildNotifier(cfg)
+			if err != nil {
+				notifierRegistryErr = err
+				return
+			}
+			registry[n.Name()] = n
+		}
+
+		var route Route
+		if err := viper.UnmarshalKey("route", &route); err != nil {
+			notifierRegistryErr = fmt.Errorf("failed to parse route config: %v", err)
+			return
+		}
+
+		notifierRegistry = registry
+		notifierRoute = route
+	})
+	return notifierRegistry, notifierRoute, notifierRegistryErr
+}
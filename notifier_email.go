@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"time"
+)
+
+// EmailConfig configures an SMTP destination.
+type EmailConfig struct {
+	SMTPHost string   `mapstructure:"smtp_host"`
+	SMTPPort int      `mapstructure:"smtp_port"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"`
+	Subject  string   `mapstructure:"subject"`
+}
+
+// EmailNotifier delivers alerts as an email with the rendered plot attached
+// inline as a PNG, so the graph is visible without following a link.
+type EmailNotifier struct {
+	name   string
+	config EmailConfig
+}
+
+func NewEmailNotifier(name string, config EmailConfig) *EmailNotifier {
+	return &EmailNotifier{name: name, config: config}
+}
+
+func (n *EmailNotifier) Name() string { return n.name }
+
+func (n *EmailNotifier) Notify(alert Alert, plot NotifyPlot) error {
+	msg, err := buildAlertEmail(n.config, alert, plot)
+	if err != nil {
+		return fmt.Errorf("failed to build email: %v", err)
+	}
+
+	addr := fmt.Sprintf("%s:%d", n.config.SMTPHost, n.config.SMTPPort)
+	var auth smtp.Auth
+	if n.config.Username != "" {
+		auth = smtp.PlainAuth("", n.config.Username, n.config.Password, n.config.SMTPHost)
+	}
+
+	if err := sendMailWithTimeout(addr, n.config.SMTPHost, auth, n.config.From, n.config.To, msg, notifierTimeout()); err != nil {
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+	return nil
+}
+
+// sendMailWithTimeout is smtp.SendMail with a deadline on the underlying
+// connection, so an unresponsive or slow-loris SMTP server can't hang the
+// goroutine it runs in forever -- exactly the failure mode notifierHTTPClient
+// exists to rule out for the HTTP-based notifiers.
+func sendMailWithTimeout(addr, host string, auth smtp.Auth, from string, to []string, msg []byte, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("starttls: %v", err)
+		}
+	}
+
+	if auth != nil {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err := client.Auth(auth); err != nil {
+				return fmt.Errorf("auth: %v", err)
+			}
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// buildAlertEmail renders a multipart/mixed message with an HTML summary of
+// the alert as the body and the plot attached inline as a PNG.
+func buildAlertEmail(config EmailConfig, alert Alert, plot NotifyPlot) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	subject := config.Subject
+	if subject == "" {
+		subject = fmt.Sprintf("[%s] %s", alert.Status, alert.Annotations["summary"])
+	}
+
+	fmt.Fprintf(&buf, "From: %s\r\n", config.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", joinAddresses(config.To))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", writer.Boundary())
+
+	htmlPart, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"text/html; charset=UTF-8"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(htmlPart, "<p><b>%s</b></p><p>%s</p><img src=\"cid:plot.png\">",
+		alert.Annotations["summary"], alert.Annotations["description"])
+
+	imgPart, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"image/png"},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {"inline; filename=\"plot.png\""},
+		"Content-ID":                {"<plot.png>"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	encoded := make([]byte, base64.StdEncoding.EncodedLen(len(plot.PNG)))
+	base64.StdEncoding.Encode(encoded, plot.PNG)
+	if _, err := imgPart.Write(encoded); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func joinAddresses(addrs []string) string {
+	out := ""
+	for i, a := range addrs {
+		if i > 0 {
+			out += ", "
+		}
+		out += a
+	}
+	return out
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDutyConfig configures a PagerDuty Events API v2 destination.
+type PagerDutyConfig struct {
+	IntegrationKey string `mapstructure:"integration_key"`
+}
+
+// PagerDutyNotifier delivers alerts as PagerDuty Events API v2 events,
+// triggering on firing alerts and resolving on resolved ones.
+type PagerDutyNotifier struct {
+	name   string
+	config PagerDutyConfig
+}
+
+func NewPagerDutyNotifier(name string, config PagerDutyConfig) *PagerDutyNotifier {
+	return &PagerDutyNotifier{name: name, config: config}
+}
+
+func (n *PagerDutyNotifier) Name() string { return n.name }
+
+type pagerDutyEvent struct {
+	RoutingKey  string                `json:"routing_key"`
+	EventAction string                `json:"event_action"`
+	DedupKey    string                `json:"dedup_key"`
+	Payload     pagerDutyEventPayload `json:"payload"`
+	Links       []pagerDutyEventLink  `json:"links,omitempty"`
+}
+
+type pagerDutyEventPayload struct {
+	Summary  string `json:"summary"`
+	Source   string `json:"source"`
+	Severity string `json:"severity"`
+}
+
+type pagerDutyEventLink struct {
+	Href string `json:"href"`
+	Text string `json:"text"`
+}
+
+func (n *PagerDutyNotifier) Notify(alert Alert, plot NotifyPlot) error {
+	action := "trigger"
+	if alert.Status == "resolved" {
+		action = "resolve"
+	}
+
+	severity := alert.Labels["severity"]
+	if severity == "" {
+		severity = "warning"
+	}
+
+	event := pagerDutyEvent{
+		RoutingKey:  n.config.IntegrationKey,
+		EventAction: action,
+		DedupKey:    alert.Fingerprint,
+		Payload: pagerDutyEventPayload{
+			Summary:  alert.Annotations["summary"],
+			Source:   alert.Labels["instance"],
+			Severity: severity,
+		},
+		Links: []pagerDutyEventLink{{Href: plot.URL, Text: "Graph"}},
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pagerduty event: %v", err)
+	}
+
+	resp, err := notifierHTTPClient().Post(pagerDutyEventsURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to send pagerduty event: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		err := fmt.Errorf("pagerduty returned unexpected status: %s", resp.Status)
+		if httpStatusRetryable(resp.StatusCode) {
+			return &retryableError{err: err, retryAfter: retryAfterFromResponse(resp)}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package main
+
+// SlackConfig configures a Slack destination.
+type SlackConfig struct {
+	Token           string `mapstructure:"token"`
+	Channel         string `mapstructure:"channel"`
+	MessageTemplate string `mapstructure:"message_template"`
+}
+
+// SlackNotifier delivers alerts to a Slack channel via SlackSendAlertMessage.
+type SlackNotifier struct {
+	name   string
+	config SlackConfig
+}
+
+func NewSlackNotifier(name string, config SlackConfig) *SlackNotifier {
+	return &SlackNotifier{name: name, config: config}
+}
+
+func (n *SlackNotifier) Name() string { return n.name }
+
+func (n *SlackNotifier) Notify(alert Alert, plot NotifyPlot) error {
+	_, _, err := SlackSendAlertMessage(alert, n.config.Token, n.config.Channel, plot.URL, n.config.MessageTemplate)
+	return err
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// TeamsConfig configures a Microsoft Teams incoming webhook destination.
+type TeamsConfig struct {
+	WebhookURL string `mapstructure:"webhook_url"`
+}
+
+// TeamsNotifier delivers alerts to Microsoft Teams as an Office 365
+// connector MessageCard with the plot linked as a card action.
+type TeamsNotifier struct {
+	name   string
+	config TeamsConfig
+}
+
+func NewTeamsNotifier(name string, config TeamsConfig) *TeamsNotifier {
+	return &TeamsNotifier{name: name, config: config}
+}
+
+func (n *TeamsNotifier) Name() string { return n.name }
+
+type teamsMessageCard struct {
+	Type       string               `json:"@type"`
+	Context    string               `json:"@context"`
+	ThemeColor string               `json:"themeColor"`
+	Summary    string               `json:"summary"`
+	Title      string               `json:"title"`
+	Text       string               `json:"text"`
+	Actions    []teamsOpenURIAction `json:"potentialAction"`
+}
+
+type teamsOpenURIAction struct {
+	Type    string              `json:"@type"`
+	Name    string              `json:"name"`
+	Targets []teamsActionTarget `json:"targets"`
+}
+
+type teamsActionTarget struct {
+	OS  string `json:"os"`
+	URI string `json:"uri"`
+}
+
+func (n *TeamsNotifier) Notify(alert Alert, plot NotifyPlot) error {
+	color := "0076D7"
+	if alert.Status == "resolved" {
+		color = "2EB886"
+	}
+
+	card := teamsMessageCard{
+		Type:       "MessageCard",
+		Context:    "http://schema.org/extensions",
+		ThemeColor: color,
+		Summary:    alert.Annotations["summary"],
+		Title:      fmt.Sprintf("[%s] %s", alert.Status, alert.Annotations["summary"]),
+		Text:       alert.Annotations["description"],
+		Actions: []teamsOpenURIAction{{
+			Type:    "OpenUri",
+			Name:    "View graph",
+			Targets: []teamsActionTarget{{OS: "default", URI: plot.URL}},
+		}},
+	}
+
+	body, err := json.Marshal(card)
+	if err != nil {
+		return fmt.Errorf("failed to marshal teams message card: %v", err)
+	}
+
+	resp, err := notifierHTTPClient().Post(n.config.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to send teams message: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		err := fmt.Errorf("teams webhook returned unexpected status: %s", resp.Status)
+		if httpStatusRetryable(resp.StatusCode) {
+			return &retryableError{err: err, retryAfter: retryAfterFromResponse(resp)}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// TelegramConfig configures a Telegram Bot API destination.
+type TelegramConfig struct {
+	BotToken string `mapstructure:"bot_token"`
+	ChatID   string `mapstructure:"chat_id"`
+}
+
+// TelegramNotifier delivers alerts as a Telegram message via the Bot API's
+// sendMessage method, linking the plot rather than uploading it.
+type TelegramNotifier struct {
+	name   string
+	config TelegramConfig
+}
+
+func NewTelegramNotifier(name string, config TelegramConfig) *TelegramNotifier {
+	return &TelegramNotifier{name: name, config: config}
+}
+
+func (n *TelegramNotifier) Name() string { return n.name }
+
+type telegramSendMessageRequest struct {
+	ChatID    string `json:"chat_id"`
+	Text      string `json:"text"`
+	ParseMode string `json:"parse_mode"`
+}
+
+// telegramMarkdownV2Escaper escapes the characters Telegram's MarkdownV2
+// parse mode reserves for formatting. Alert data is free text -- a
+// hostname with an underscore or a description with a bare asterisk is
+// routine -- and an odd count of any of these makes the Bot API reject the
+// whole message with "can't parse entities" instead of just rendering it
+// literally.
+var telegramMarkdownV2Escaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"_", "\\_", "*", "\\*", "[", "\\[", "]", "\\]", "(", "\\(", ")", "\\)",
+	"~", "\\~", "`", "\\`", ">", "\\>", "#", "\\#", "+", "\\+", "-", "\\-",
+	"=", "\\=", "|", "\\|", "{", "\\{", "}", "\\}", ".", "\\.", "!", "\\!",
+)
+
+// telegramMarkdownV2LinkEscaper escapes the narrower set of characters
+// MarkdownV2 requires escaping inside a link destination, i.e. the part of
+// [text](here).
+var telegramMarkdownV2LinkEscaper = strings.NewReplacer("\\", "\\\\", ")", "\\)")
+
+func (n *TelegramNotifier) Notify(alert Alert, plot NotifyPlot) error {
+	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", n.config.BotToken)
+
+	text := fmt.Sprintf("*\\[%s\\]* %s\n%s\n[Graph](%s)",
+		telegramMarkdownV2Escaper.Replace(string(alert.Status)),
+		telegramMarkdownV2Escaper.Replace(alert.Annotations["summary"]),
+		telegramMarkdownV2Escaper.Replace(alert.Annotations["description"]),
+		telegramMarkdownV2LinkEscaper.Replace(plot.URL))
+
+	body, err := json.Marshal(telegramSendMessageRequest{
+		ChatID:    n.config.ChatID,
+		Text:      text,
+		ParseMode: "MarkdownV2",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal telegram message: %v", err)
+	}
+
+	resp, err := notifierHTTPClient().Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to send telegram message: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		err := fmt.Errorf("telegram API returned unexpected status: %s", resp.Status)
+		if httpStatusRetryable(resp.StatusCode) {
+			return &retryableError{err: err, retryAfter: retryAfterFromResponse(resp)}
+		}
+		return err
+	}
+	return nil
+}
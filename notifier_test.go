@@ -0,0 +1,107 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestRouteMatches(t *testing.T) {
+	route := Route{Match: map[string]string{"severity": "critical", "team": "sre"}}
+
+	cases := []struct {
+		name   string
+		labels map[string]string
+		want   bool
+	}{
+		{"exact match", map[string]string{"severity": "critical", "team": "sre"}, true},
+		{"superset of labels still matches", map[string]string{"severity": "critical", "team": "sre", "env": "prod"}, true},
+		{"missing label", map[string]string{"severity": "critical"}, false},
+		{"mismatched value", map[string]string{"severity": "warning", "team": "sre"}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := route.matches(tc.labels); got != tc.want {
+				t.Errorf("matches(%v) = %v, want %v", tc.labels, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolveNotifiersFirstMatchWins(t *testing.T) {
+	root := Route{
+		Notifiers: []string{"default"},
+		Routes: []Route{
+			{Match: map[string]string{"team": "sre"}, Notifiers: []string{"sre-pager"}},
+			{Match: map[string]string{"team": "sre"}, Notifiers: []string{"sre-slack"}},
+		},
+	}
+
+	got := ResolveNotifiers(root, map[string]string{"team": "sre"})
+	want := []string{"default", "sre-pager"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ResolveNotifiers() = %v, want %v (only the first matching sibling)", got, want)
+	}
+}
+
+func TestResolveNotifiersContinueEvaluatesRemainingSiblings(t *testing.T) {
+	root := Route{
+		Routes: []Route{
+			{Match: map[string]string{"team": "sre"}, Notifiers: []string{"sre-pager"}, Continue: true},
+			{Match: map[string]string{"team": "sre"}, Notifiers: []string{"sre-slack"}},
+			{Match: map[string]string{"team": "sre"}, Notifiers: []string{"sre-email"}},
+		},
+	}
+
+	got := ResolveNotifiers(root, map[string]string{"team": "sre"})
+	sort.Strings(got)
+	want := []string{"sre-pager", "sre-slack"}
+	sort.Strings(want)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ResolveNotifiers() = %v, want %v (continue keeps evaluating siblings, but still stops at the next non-continue match)", got, want)
+	}
+}
+
+func TestResolveNotifiersRecursesIntoMatchedChildren(t *testing.T) {
+	root := Route{
+		Routes: []Route{
+			{
+				Match:     map[string]string{"team": "sre"},
+				Notifiers: []string{"sre-pager"},
+				Routes: []Route{
+					{Match: map[string]string{"severity": "critical"}, Notifiers: []string{"sre-oncall"}},
+				},
+			},
+		},
+	}
+
+	got := ResolveNotifiers(root, map[string]string{"team": "sre", "severity": "critical"})
+	want := []string{"sre-pager", "sre-oncall"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ResolveNotifiers() = %v, want %v", got, want)
+	}
+}
+
+func TestResolveNotifiersNoMatchReturnsNil(t *testing.T) {
+	root := Route{
+		Match:     map[string]string{"team": "payments"},
+		Notifiers: []string{"default"},
+	}
+
+	if got := ResolveNotifiers(root, map[string]string{"team": "sre"}); got != nil {
+		t.Errorf("ResolveNotifiers() = %v, want nil", got)
+	}
+}
+
+func TestDedupeStrings(t *testing.T) {
+	got := dedupeStrings([]string{"a", "b", "a", "c", "b"})
+	want := []string{"a", "b", "c"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dedupeStrings() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// WebhookConfig configures a generic outbound webhook destination.
+type WebhookConfig struct {
+	URL string `mapstructure:"url"`
+}
+
+// WebhookNotifier POSTs the alert, unmodified, alongside the rendered plot
+// URL as JSON, for destinations without a dedicated integration.
+type WebhookNotifier struct {
+	name   string
+	config WebhookConfig
+}
+
+func NewWebhookNotifier(name string, config WebhookConfig) *WebhookNotifier {
+	return &WebhookNotifier{name: name, config: config}
+}
+
+func (n *WebhookNotifier) Name() string { return n.name }
+
+type webhookPayload struct {
+	Alert   Alert  `json:"alert"`
+	PlotURL string `json:"plot_url"`
+}
+
+func (n *WebhookNotifier) Notify(alert Alert, plot NotifyPlot) error {
+	body, err := json.Marshal(webhookPayload{Alert: alert, PlotURL: plot.URL})
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %v", err)
+	}
+
+	resp, err := notifierHTTPClient().Post(n.config.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		err := fmt.Errorf("webhook returned unexpected status: %s", resp.Status)
+		if httpStatusRetryable(resp.StatusCode) {
+			return &retryableError{err: err, retryAfter: retryAfterFromResponse(resp)}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookNotifierSendsAlertAndPlotURL(t *testing.T) {
+	var got webhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatalf("failed to decode webhook payload: %v", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	n := NewWebhookNotifier("webhook", WebhookConfig{URL: server.URL})
+	alert := Alert{Fingerprint: "abc123", Status: "firing"}
+
+	if err := n.Notify(alert, NotifyPlot{URL: "https://example.com/plot.png"}); err != nil {
+		t.Fatalf("Notify() = %v, want nil", err)
+	}
+
+	if got.Alert.Fingerprint != alert.Fingerprint || got.PlotURL != "https://example.com/plot.png" {
+		t.Errorf("server received %+v, want fingerprint %q and plot_url %q", got, alert.Fingerprint, "https://example.com/plot.png")
+	}
+}
+
+func TestWebhookNotifierSurfacesRetryableStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	n := NewWebhookNotifier("webhook", WebhookConfig{URL: server.URL})
+	err := n.Notify(Alert{}, NotifyPlot{})
+	if err == nil {
+		t.Fatal("Notify() = nil, want error for a 503 response")
+	}
+
+	var re *retryableError
+	if !errors.As(err, &re) {
+		t.Errorf("Notify() error = %v, want a *retryableError so withRetry can honor Retry-After", err)
+	}
+}
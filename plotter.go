@@ -3,11 +3,13 @@ package main
 import (
 	"fmt"
 	"github.com/prometheus/prometheus/promql"
+	"github.com/spf13/viper"
 	"image/color"
 	"io"
 	"log"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/prometheus/common/model"
@@ -21,51 +23,119 @@ import (
 // Only show important part of metric name
 var labelText = regexp.MustCompile("{(.*)}")
 
-func GetPlotExpr(alertFormula string) []PlotExpr {
-	expr, _ := promql.ParseExpr(alertFormula)
+// PlotExpr is a single drawable component of an alert expression: the
+// sub-formula to query plus how it compares to its threshold. A single
+// top-level expression can yield several PlotExprs when it combines
+// conditions with `and`/`or`/`unless`.
+type PlotExpr struct {
+	Formula  string
+	Operator string
+	Level    float64
+	// Exclude marks a side joined with `unless`: the region it describes
+	// is one the alert must NOT be in, rather than one it must be in, so
+	// callers should tag it differently (e.g. a different polygon color).
+	Exclude bool
+	// ThresholdFormula is set instead of Level when the RHS of the
+	// comparison is itself a vector (a vector-vector comparison such as
+	// `x > y`). Callers should query it and draw it as
+	// a dynamic threshold line rather than a static horizontal band.
+	ThresholdFormula string
+}
+
+// GetPlotExpr parses a PromQL alert expression into the set of PlotExprs
+// needed to render it: `and`/`or`/`unless` combinations are split so each
+// side is drawn separately, nested parentheses are unwrapped, and a vector
+// RHS is preserved as ThresholdFormula rather than treated as a scalar
+// level.
+func GetPlotExpr(alertFormula string) ([]PlotExpr, error) {
+	expr, err := promql.ParseExpr(alertFormula)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse expression %q: %v", alertFormula, err)
+	}
+
 	if parenExpr, ok := expr.(*promql.ParenExpr); ok {
-		expr = parenExpr.Expr
-		log.Printf("Removing redundant brackets: %v", expr.String())
-	}
-
-	if binaryExpr, ok := expr.(*promql.BinaryExpr); ok {
-		var alertOperator string
-
-		switch binaryExpr.Op {
-		case promql.ItemLAND:
-			log.Printf("Logical condition, drawing sides separately")
-			return append(GetPlotExpr(binaryExpr.LHS.String()), GetPlotExpr(binaryExpr.RHS.String())...)
-		case promql.ItemLTE, promql.ItemLSS:
-			alertOperator = "<"
-		case promql.ItemGTE, promql.ItemGTR:
-			alertOperator = ">"
-		default:
-			log.Printf("Unexpected operator: %v", binaryExpr.Op.String())
-			alertOperator = ">"
-		}
+		log.Printf("Removing redundant brackets: %v", parenExpr.Expr.String())
+		return GetPlotExpr(parenExpr.Expr.String())
+	}
 
-		alertLevel, _ := strconv.ParseFloat(binaryExpr.RHS.String(), 64)
-		return []PlotExpr{PlotExpr{
-			Formula:  binaryExpr.LHS.String(),
-			Operator: alertOperator,
-			Level:    alertLevel,
-		}}
-	} else {
+	binaryExpr, ok := expr.(*promql.BinaryExpr)
+	if !ok {
 		log.Printf("Non binary excpression: %v", alertFormula)
-		return nil
+		return nil, nil
 	}
+
+	switch binaryExpr.Op {
+	case promql.ItemLAND, promql.ItemLOR, promql.ItemLUnless:
+		log.Printf("Logical condition (%s), drawing sides separately", binaryExpr.Op.String())
+
+		lhs, err := GetPlotExpr(binaryExpr.LHS.String())
+		if err != nil {
+			return nil, err
+		}
+		rhs, err := GetPlotExpr(binaryExpr.RHS.String())
+		if err != nil {
+			return nil, err
+		}
+
+		if binaryExpr.Op == promql.ItemLUnless {
+			for i := range rhs {
+				rhs[i].Exclude = true
+			}
+		}
+
+		return append(lhs, rhs...), nil
+	}
+
+	var alertOperator string
+	switch binaryExpr.Op {
+	case promql.ItemLTE, promql.ItemLSS:
+		alertOperator = "<"
+	case promql.ItemGTE, promql.ItemGTR:
+		alertOperator = ">"
+	default:
+		log.Printf("Unexpected operator: %v", binaryExpr.Op.String())
+		alertOperator = ">"
+	}
+
+	alertLevel, err := strconv.ParseFloat(binaryExpr.RHS.String(), 64)
+	if err != nil {
+		// The RHS isn't a scalar threshold but a query in its own right,
+		// e.g. `x > y`: keep it as a formula to be
+		// drawn as a dynamic threshold line instead of a static band.
+		return []PlotExpr{{
+			Formula:          binaryExpr.LHS.String(),
+			Operator:         alertOperator,
+			ThresholdFormula: binaryExpr.RHS.String(),
+		}}, nil
+	}
+
+	return []PlotExpr{{
+		Formula:  binaryExpr.LHS.String(),
+		Operator: alertOperator,
+		Level:    alertLevel,
+	}}, nil
 }
 
-func Plot(expr PlotExpr, queryTime time.Time, duration, resolution time.Duration, prometheusUrl string, alert Alert) io.WriterTo {
+// Plot queries Prometheus for expr (and its threshold formula, if any),
+// selects the series matching alert's labels, and renders it. It never
+// calls fatal: a query or render failure is returned so the caller can
+// isolate it to this alert instead of crashing the whole batch.
+func Plot(expr PlotExpr, queryTime time.Time, duration, resolution time.Duration, prometheusUrl string, alert Alert) (io.WriterTo, error) {
 	log.Printf("Querying Prometheus %s", expr.Formula)
-	metrics, err := Metrics(
-		prometheusUrl,
-		expr.Formula,
-		queryTime,
-		duration,
-		resolution,
-	)
-	fatal(err, "failed to get metrics")
+
+	queryStart := time.Now()
+	var metrics model.Matrix
+	retryErr := withRetry(retryConfig(), func() error {
+		var err error
+		metrics, err = Metrics(prometheusUrl, expr.Formula, queryTime, duration, resolution)
+		return err
+	})
+	observeSince(prometheusQueryDuration, queryStart)
+	if retryErr != nil {
+		prometheusQueriesTotal.WithLabelValues("error").Inc()
+		return nil, fmt.Errorf("failed to get metrics: %v", retryErr)
+	}
+	prometheusQueriesTotal.WithLabelValues("success").Inc()
 
 	var selectedMetrics model.Matrix
 	var founded bool
@@ -95,27 +165,92 @@ func Plot(expr PlotExpr, queryTime time.Time, duration, resolution time.Duration
 		selectedMetrics = metrics
 	}
 
+	var thresholdMetrics model.Matrix
+	if expr.ThresholdFormula != "" {
+		log.Printf("Querying Prometheus for dynamic threshold %s", expr.ThresholdFormula)
+		thresholdStart := time.Now()
+		retryErr = withRetry(retryConfig(), func() error {
+			var err error
+			thresholdMetrics, err = Metrics(prometheusUrl, expr.ThresholdFormula, queryTime, duration, resolution)
+			return err
+		})
+		observeSince(prometheusQueryDuration, thresholdStart)
+		if retryErr != nil {
+			prometheusQueriesTotal.WithLabelValues("error").Inc()
+			return nil, fmt.Errorf("failed to get threshold metrics: %v", retryErr)
+		}
+		prometheusQueriesTotal.WithLabelValues("success").Inc()
+	}
+
 	log.Printf("Creating plot: %s", alert.Annotations["summary"])
-	plottedMetric, err := PlotMetric(selectedMetrics, expr.Level, expr.Operator)
-	fatal(err, "failed to create plot")
 
-	return plottedMetric
+	style := plotStyle(expr.Formula, alert.Annotations)
+	log.Printf("Plot style: %s", style)
+
+	renderStart := time.Now()
+	var plottedMetric io.WriterTo
+	var err error
+	if style == "heatmap" {
+		plottedMetric, err = PlotHeatmap(selectedMetrics, thresholdMetrics, expr)
+	} else {
+		plottedMetric, err = PlotMetric(selectedMetrics, thresholdMetrics, expr)
+	}
+	observeSince(plotRenderDuration, renderStart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create plot: %v", err)
+	}
+
+	return plottedMetric, nil
+}
+
+// isHistogramFormula reports whether formula reads from Prometheus native
+// histogram series, which a plain line plot renders poorly once there are
+// more than a handful of `le` buckets.
+func isHistogramFormula(formula string) bool {
+	return strings.Contains(formula, "histogram_quantile") || strings.Contains(formula, "_bucket")
+}
+
+// plotStyle decides whether to render formula as a "line" or a "heatmap".
+// The `promalert_plot_style` annotation always wins when set; otherwise the
+// `plot.style` config key is used, defaulting to "auto", which picks
+// "heatmap" for histogram bucket expressions and "line" for everything else.
+func plotStyle(formula string, annotations map[string]string) string {
+	if override := annotations["promalert_plot_style"]; override != "" {
+		return override
+	}
+
+	style := viper.GetString("plot.style")
+	if style == "" {
+		style = "auto"
+	}
+
+	if style != "auto" {
+		return style
+	}
+
+	if isHistogramFormula(formula) {
+		return "heatmap"
+	}
+	return "line"
 }
 
-func PlotMetric(metrics model.Matrix, level float64, direction string) (io.WriterTo, error) {
+// newStyledPlot creates a plot with the fonts, tick formatting and legend
+// placement shared by every plot style, plus the text style used to
+// annotate the latest evaluated value.
+func newStyledPlot() (*plot.Plot, draw.TextStyle, error) {
 	p, err := plot.New()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create new plot: %v", err)
+		return nil, draw.TextStyle{}, fmt.Errorf("failed to create new plot: %v", err)
 	}
 
 	textFont, err := vg.MakeFont("Helvetica", 3*vg.Millimeter)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load font: %v", err)
+		return nil, draw.TextStyle{}, fmt.Errorf("failed to load font: %v", err)
 	}
 
 	evalTextFont, err := vg.MakeFont("Helvetica", 5*vg.Millimeter)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load font: %v", err)
+		return nil, draw.TextStyle{}, fmt.Errorf("failed to load font: %v", err)
 	}
 
 	evalTextStyle := draw.TextStyle{
@@ -132,6 +267,49 @@ func PlotMetric(metrics model.Matrix, level float64, direction string) (io.Write
 	p.Legend.Top = true
 	p.Legend.YOffs = 15 * vg.Millimeter
 
+	return p, evalTextStyle, nil
+}
+
+// renderPlotCanvas draws p onto a fixed-size PNG canvas and stamps the
+// latest evaluated value in the bottom right corner.
+func renderPlotCanvas(p *plot.Plot, evalTextStyle draw.TextStyle, lastEvalValue float64) (io.WriterTo, error) {
+	margin := 6 * vg.Millimeter
+	width := 20 * vg.Centimeter
+	height := 10 * vg.Centimeter
+	c, err := draw.NewFormattedCanvas(width, height, "png")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create canvas: %v", err)
+	}
+
+	cropedCanvas := draw.Crop(draw.New(c), margin, -margin, margin, -margin)
+	p.Draw(cropedCanvas)
+
+	// Draw last evaluated value
+	evalText := fmt.Sprintf("latest evaluation: %.2f", lastEvalValue)
+
+	plotterCanvas := p.DataCanvas(cropedCanvas)
+
+	trX, trY := p.Transforms(&plotterCanvas)
+	evalRectangle := evalTextStyle.Rectangle(evalText)
+
+	points := []vg.Point{
+		{X: trX(p.X.Max) + evalRectangle.Min.X - 8*vg.Millimeter, Y: trY(lastEvalValue) + evalRectangle.Min.Y - vg.Millimeter},
+		{X: trX(p.X.Max) + evalRectangle.Min.X - 8*vg.Millimeter, Y: trY(lastEvalValue) + evalRectangle.Max.Y + vg.Millimeter},
+		{X: trX(p.X.Max) + evalRectangle.Max.X - 6*vg.Millimeter, Y: trY(lastEvalValue) + evalRectangle.Max.Y + vg.Millimeter},
+		{X: trX(p.X.Max) + evalRectangle.Max.X - 6*vg.Millimeter, Y: trY(lastEvalValue) + evalRectangle.Min.Y - vg.Millimeter},
+	}
+	plotterCanvas.FillPolygon(color.NRGBA{R: 255, G: 255, B: 255, A: 90}, points)
+	plotterCanvas.FillText(evalTextStyle, vg.Point{X: trX(p.X.Max) - 6*vg.Millimeter, Y: trY(lastEvalValue)}, evalText)
+
+	return c, nil
+}
+
+func PlotMetric(metrics, thresholdMetrics model.Matrix, expr PlotExpr) (io.WriterTo, error) {
+	p, evalTextStyle, err := newStyledPlot()
+	if err != nil {
+		return nil, err
+	}
+
 	// Color palette for drawing lines
 	paletteSize := 8
 	palette, err := brewer.GetPalette(brewer.TypeAny, "Dark2", paletteSize)
@@ -170,51 +348,56 @@ func PlotMetric(metrics model.Matrix, level float64, direction string) (io.Write
 		}
 	}
 
-	var polygonPoints plotter.XYs
-
-	if direction == "<" {
-		polygonPoints = plotter.XYs{{X: p.X.Min, Y: level}, {X: p.X.Max, Y: level}, {X: p.X.Max, Y: p.Y.Min}, {X: p.X.Min, Y: p.Y.Min}}
-	} else {
-		polygonPoints = plotter.XYs{{X: p.X.Min, Y: level}, {X: p.X.Max, Y: level}, {X: p.X.Max, Y: p.Y.Max}, {X: p.X.Min, Y: p.Y.Max}}
-	}
-
-	poly, err := plotter.NewPolygon(polygonPoints)
-	if err != nil {
-		log.Panic(err)
-	}
-	poly.Color = color.NRGBA{R: 255, A: 40}
-	poly.LineStyle.Color = color.NRGBA{R: 0, A: 0}
-	p.Add(poly)
-	p.Add(plotter.NewGrid())
-
-	// Draw plot in canvas with margin
-	margin := 6 * vg.Millimeter
-	width := 20 * vg.Centimeter
-	height := 10 * vg.Centimeter
-	c, err := draw.NewFormattedCanvas(width, height, "png")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create canvas: %v", err)
+	// Alert regions tagged Exclude (the `unless` side of an expression)
+	// are shaded blue instead of red, since they mark territory the
+	// alert must stay out of rather than territory that triggers it.
+	shade := color.NRGBA{R: 255, A: 40}
+	if expr.Exclude {
+		shade = color.NRGBA{B: 255, A: 40}
 	}
 
-	cropedCanvas := draw.Crop(draw.New(c), margin, -margin, margin, -margin)
-	p.Draw(cropedCanvas)
-
-	// Draw last evaluated value
-	evalText := fmt.Sprintf("latest evaluation: %.2f", lastEvalValue)
+	if len(thresholdMetrics) > 0 {
+		// The threshold is itself a query result: draw it as a dynamic
+		// line rather than a static horizontal band.
+		for _, sample := range thresholdMetrics {
+			data := make(plotter.XYs, len(sample.Values))
+			for i, v := range sample.Values {
+				data[i].X = float64(v.Timestamp.Unix())
+				f, err := strconv.ParseFloat(v.Value.String(), 64)
+				if err != nil {
+					return nil, fmt.Errorf("threshold sample value not float: %s", v.Value.String())
+				}
+				data[i].Y = f
+			}
 
-	plotterCanvas := p.DataCanvas(cropedCanvas)
+			l, err := plotter.NewLine(data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create threshold line: %v", err)
+			}
+			l.LineStyle.Width = vg.Points(1)
+			l.LineStyle.Color = shade
+			l.LineStyle.Dashes = []vg.Length{vg.Points(4), vg.Points(2)}
+			p.Add(l)
+		}
+	} else {
+		var polygonPoints plotter.XYs
 
-	trX, trY := p.Transforms(&plotterCanvas)
-	evalRectangle := evalTextStyle.Rectangle(evalText)
+		if expr.Operator == "<" {
+			polygonPoints = plotter.XYs{{X: p.X.Min, Y: expr.Level}, {X: p.X.Max, Y: expr.Level}, {X: p.X.Max, Y: p.Y.Min}, {X: p.X.Min, Y: p.Y.Min}}
+		} else {
+			polygonPoints = plotter.XYs{{X: p.X.Min, Y: expr.Level}, {X: p.X.Max, Y: expr.Level}, {X: p.X.Max, Y: p.Y.Max}, {X: p.X.Min, Y: p.Y.Max}}
+		}
 
-	points := []vg.Point{
-		{X: trX(p.X.Max) + evalRectangle.Min.X - 8*vg.Millimeter, Y: trY(lastEvalValue) + evalRectangle.Min.Y - vg.Millimeter},
-		{X: trX(p.X.Max) + evalRectangle.Min.X - 8*vg.Millimeter, Y: trY(lastEvalValue) + evalRectangle.Max.Y + vg.Millimeter},
-		{X: trX(p.X.Max) + evalRectangle.Max.X - 6*vg.Millimeter, Y: trY(lastEvalValue) + evalRectangle.Max.Y + vg.Millimeter},
-		{X: trX(p.X.Max) + evalRectangle.Max.X - 6*vg.Millimeter, Y: trY(lastEvalValue) + evalRectangle.Min.Y - vg.Millimeter},
+		poly, err := plotter.NewPolygon(polygonPoints)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create alert region: %v", err)
+		}
+		poly.Color = shade
+		poly.LineStyle.Color = color.NRGBA{R: 0, A: 0}
+		p.Add(poly)
 	}
-	plotterCanvas.FillPolygon(color.NRGBA{R: 255, G: 255, B: 255, A: 90}, points)
-	plotterCanvas.FillText(evalTextStyle, vg.Point{X: trX(p.X.Max) - 6*vg.Millimeter, Y: trY(lastEvalValue)}, evalText)
 
-	return c, nil
+	p.Add(plotter.NewGrid())
+
+	return renderPlotCanvas(p, evalTextStyle, lastEvalValue)
 }
@@ -0,0 +1,93 @@
+package main
+
+import "testing"
+
+func TestGetPlotExpr(t *testing.T) {
+	cases := []struct {
+		name    string
+		formula string
+		want    []PlotExpr
+	}{
+		{
+			name:    "and of two scalar thresholds",
+			formula: "rate(x[5m]) > 0.5 and rate(x[5m] offset 1h) < 0.1",
+			want: []PlotExpr{
+				{Formula: "rate(x[5m])", Operator: ">", Level: 0.5},
+				{Formula: "rate(x[5m] offset 1h)", Operator: "<", Level: 0.1},
+			},
+		},
+		{
+			name:    "equality idiom",
+			formula: "up == 0",
+			want: []PlotExpr{
+				{Formula: "up", Operator: ">", Level: 0},
+			},
+		},
+		{
+			name:    "vector arithmetic against a scalar threshold",
+			formula: "x / on(instance) y > 0.9",
+			want: []PlotExpr{
+				{Formula: "x / on(instance) y", Operator: ">", Level: 0.9},
+			},
+		},
+		{
+			name:    "or splits both sides",
+			formula: "up == 0 or rate(errors[5m]) > 1",
+			want: []PlotExpr{
+				{Formula: "up", Operator: ">", Level: 0},
+				{Formula: "rate(errors[5m])", Operator: ">", Level: 1},
+			},
+		},
+		{
+			name:    "unless tags the excluded side",
+			formula: "rate(x[5m]) > 0.5 unless rate(maintenance[5m]) > 0",
+			want: []PlotExpr{
+				{Formula: "rate(x[5m])", Operator: ">", Level: 0.5},
+				{Formula: "rate(maintenance[5m])", Operator: ">", Level: 0, Exclude: true},
+			},
+		},
+		{
+			name:    "redundant parentheses are unwrapped",
+			formula: "(up == 0)",
+			want: []PlotExpr{
+				{Formula: "up", Operator: ">", Level: 0},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := GetPlotExpr(tc.formula)
+			if err != nil {
+				t.Fatalf("GetPlotExpr(%q) returned error: %v", tc.formula, err)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("GetPlotExpr(%q) = %+v, want %+v", tc.formula, got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("GetPlotExpr(%q)[%d] = %+v, want %+v", tc.formula, i, got[i], tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGetPlotExprVectorVectorComparisonUsesThresholdFormula(t *testing.T) {
+	got, err := GetPlotExpr("x > y")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected a single PlotExpr, got %d", len(got))
+	}
+	if got[0].Formula != "x" || got[0].ThresholdFormula != "y" {
+		t.Errorf("GetPlotExpr(\"x > y\") = %+v, want Formula=x ThresholdFormula=y", got[0])
+	}
+}
+
+func TestGetPlotExprInvalidExpression(t *testing.T) {
+	if _, err := GetPlotExpr("this is not promql {"); err == nil {
+		t.Fatal("expected a parse error, got nil")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// RetryConfig configures the exponential-backoff retry policy applied to
+// outbound calls (Prometheus queries, S3 uploads, Notifier sends).
+type RetryConfig struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func defaultRetryConfig() RetryConfig {
+	return RetryConfig{MaxAttempts: 3, BaseDelay: 200 * time.Millisecond, MaxDelay: 5 * time.Second}
+}
+
+// retryConfig reads the `retry` config section, falling back to
+// defaultRetryConfig for anything left unset.
+func retryConfig() RetryConfig {
+	cfg := defaultRetryConfig()
+	if v := viper.GetInt("retry.max_attempts"); v > 0 {
+		cfg.MaxAttempts = v
+	}
+	if v := viper.GetDuration("retry.base_delay"); v > 0 {
+		cfg.BaseDelay = v
+	}
+	if v := viper.GetDuration("retry.max_delay"); v > 0 {
+		cfg.MaxDelay = v
+	}
+	return cfg
+}
+
+// retryableError lets a failed call report a server-specified retry delay
+// (an HTTP Retry-After header), which takes priority over the exponential
+// backoff schedule when present.
+type retryableError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// withRetry runs fn up to cfg.MaxAttempts times, backing off exponentially
+// with jitter between attempts, or honoring a *retryableError's retryAfter
+// when fn returns one.
+func withRetry(cfg RetryConfig, fn func() error) error {
+	var err error
+	delay := cfg.BaseDelay
+
+	for attempt := 1; attempt <= cfg.MaxAttempts; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if attempt == cfg.MaxAttempts {
+			break
+		}
+
+		wait := delay
+		var re *retryableError
+		if errors.As(err, &re) && re.retryAfter > 0 {
+			wait = re.retryAfter
+		}
+		if wait > cfg.MaxDelay {
+			wait = cfg.MaxDelay
+		}
+
+		time.Sleep(wait + time.Duration(rand.Int63n(int64(wait)/2+1)))
+		delay *= 2
+	}
+
+	return err
+}
+
+// httpStatusRetryable reports whether an HTTP response status is worth
+// retrying: rate limiting and server errors, but not other 4xx responses.
+func httpStatusRetryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// retryAfterFromResponse parses a Retry-After header, which may be either
+// a number of seconds or an HTTP date, returning zero if absent or invalid.
+func retryAfterFromResponse(resp *http.Response) time.Duration {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(v); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if when, err := http.ParseTime(v); err == nil {
+		return time.Until(when)
+	}
+	return 0
+}
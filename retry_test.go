@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithRetrySucceedsAfterFailures(t *testing.T) {
+	attempts := 0
+	err := withRetry(RetryConfig{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}, func() error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("transient")
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("withRetry() = %v, want nil", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("attempts = %d, want 3", attempts)
+	}
+}
+
+func TestWithRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	attempts := 0
+	err := withRetry(RetryConfig{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}, func() error {
+		attempts++
+		return errors.New("permanent")
+	})
+
+	if err == nil {
+		t.Fatal("withRetry() = nil, want error")
+	}
+	if attempts != 2 {
+		t.Fatalf("attempts = %d, want 2", attempts)
+	}
+}
+
+func TestRetryAfterFromResponse(t *testing.T) {
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"2"}}}
+	if got := retryAfterFromResponse(resp); got != 2*time.Second {
+		t.Errorf("retryAfterFromResponse() = %v, want 2s", got)
+	}
+}
+
+func TestHTTPStatusRetryable(t *testing.T) {
+	cases := map[int]bool{
+		http.StatusOK:                  false,
+		http.StatusBadRequest:          false,
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+	}
+	for status, want := range cases {
+		if got := httpStatusRetryable(status); got != want {
+			t.Errorf("httpStatusRetryable(%d) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func TestServiceUnavailableResponseIsRetryable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("failed to reach test server: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if !httpStatusRetryable(resp.StatusCode) {
+		t.Fatalf("expected status %d to be retryable", resp.StatusCode)
+	}
+}